@@ -0,0 +1,216 @@
+// Client-side codec for the JSON-RPC-ish dialect spoken by an XR router's
+// `json_rpc_server`: one JSON object per request, one per response, with
+// named (not positional) params. Wraps that into a stock *net/rpc.Client so
+// the rest of xrm2m can just use Call/Go as normal.
+
+package jsonrpc2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+)
+
+type request struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type response struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *responseError  `json:"error"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// limitedReader enforces a hard cap (read from max, so the caller can adjust
+// it on the fly) on the bytes read for a single response, returning an
+// explicit error instead of letting an oversized response grow without
+// bound. A max of <= 0 means unlimited. Call reset before reading each new
+// response.
+type limitedReader struct {
+	r   io.Reader
+	max *int64
+	n   int64
+}
+
+// LimitReader wraps r so that, once *max cumulative bytes have been read
+// from it, further reads fail with an explicit error rather than
+// continuing to buffer data. A max of <= 0 (including a nil pointer) means
+// unlimited; *max can be changed at any time between reads.
+func LimitReader(r io.Reader, max *int64) io.Reader {
+	return &limitedReader{r: r, max: max}
+}
+
+func (l *limitedReader) reset() { l.n = 0 }
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	max := int64(0)
+	if l.max != nil {
+		max = atomic.LoadInt64(l.max)
+	}
+	if max > 0 {
+		if l.n >= max {
+			return 0, fmt.Errorf("jsonrpc2: response exceeded %d byte limit", max)
+		}
+		if remaining := max - l.n; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	return n, err
+}
+
+// Resettable is implemented by a transport, such as *xrm2m.XrSession, that
+// can silently reconnect underneath its caller. A clientCodec that talks to
+// one uses Generation to notice when a reconnect happened while a request
+// was outstanding - its bytes are gone, and the new connection's peer has no
+// memory of it - and fails that call explicitly instead of leaving it
+// pending forever.
+type Resettable interface {
+	Generation() int64
+}
+
+type pendingCall struct {
+	method     string
+	generation int64 // rwc's generation at the time this request was written
+}
+
+// clientCodec implements rpc.ClientCodec. net/rpc guarantees a single
+// goroutine calls ReadResponseHeader followed by ReadResponseBody, so
+// lastResp needs no locking of its own; pending is guarded separately
+// because WriteRequest can run concurrently with that reader goroutine.
+type clientCodec struct {
+	limited    *limitedReader
+	dec        *json.Decoder
+	enc        *json.Encoder
+	rwc        io.ReadWriteCloser
+	resettable Resettable // nil if rwc doesn't support it
+
+	mu       sync.Mutex
+	pending  map[uint64]pendingCall
+	lastResp response
+}
+
+func newClientCodec(rwc io.ReadWriteCloser, maxResponseBytes *int64) *clientCodec {
+	limited := &limitedReader{r: rwc, max: maxResponseBytes}
+	resettable, _ := rwc.(Resettable)
+	return &clientCodec{
+		limited:    limited,
+		dec:        json.NewDecoder(limited),
+		enc:        json.NewEncoder(rwc),
+		rwc:        rwc,
+		resettable: resettable,
+		pending:    make(map[uint64]pendingCall),
+	}
+}
+
+func (c *clientCodec) generation() int64 {
+	if c.resettable == nil {
+		return 0
+	}
+	return c.resettable.Generation()
+}
+
+func (c *clientCodec) WriteRequest(r *rpc.Request, param interface{}) error {
+	c.mu.Lock()
+	c.pending[r.Seq] = pendingCall{method: r.ServiceMethod, generation: c.generation()}
+	c.mu.Unlock()
+
+	return c.enc.Encode(&request{
+		Jsonrpc: "2.0",
+		Id:      r.Seq,
+		Method:  r.ServiceMethod,
+		Params:  param,
+	})
+}
+
+// orphaned picks out one pending call, if any, whose request was written
+// before the transport's current generation - meaning a reconnect happened
+// after it was sent, so no reply for it will ever arrive - and removes it
+// from pending so it can be failed explicitly.
+func (c *clientCodec) orphaned() (id uint64, method string, ok bool) {
+	if c.resettable == nil {
+		return 0, "", false
+	}
+	gen := c.resettable.Generation()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for seq, call := range c.pending {
+		if call.generation != gen {
+			delete(c.pending, seq)
+			return seq, call.method, true
+		}
+	}
+	return 0, "", false
+}
+
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+	if id, method, ok := c.orphaned(); ok {
+		r.ServiceMethod = method
+		r.Seq = id
+		r.Error = "jsonrpc2: session reconnected while this call was in flight; resend it"
+		return nil
+	}
+
+	c.limited.reset()
+
+	var resp response
+	if err := c.dec.Decode(&resp); err != nil {
+		return err
+	}
+	c.lastResp = resp
+
+	c.mu.Lock()
+	r.ServiceMethod = c.pending[resp.Id].method
+	delete(c.pending, resp.Id)
+	c.mu.Unlock()
+
+	r.Seq = resp.Id
+	if resp.Error != nil {
+		r.Error = resp.Error.Error()
+	} else {
+		r.Error = ""
+	}
+	return nil
+}
+
+func (c *clientCodec) ReadResponseBody(body interface{}) error {
+	if body == nil || len(c.lastResp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(c.lastResp.Result, body)
+}
+
+func (c *clientCodec) Close() error {
+	return c.rwc.Close()
+}
+
+// NewClient wraps rwc - an open connection to a running `json_rpc_server`,
+// such as an *xrm2m.XrSession - as an *rpc.Client speaking the XR M2M
+// dialect.
+//
+// If maxResponseBytes is non-nil and *maxResponseBytes > 0, any single
+// response whose cumulative size exceeds it fails with an explicit error
+// instead of being buffered without bound; pass nil for no limit. The value
+// it points to can be changed at any time, taking effect from the next
+// response read.
+func NewClient(rwc io.ReadWriteCloser, maxResponseBytes *int64) *rpc.Client {
+	return rpc.NewClientWithCodec(newClientCodec(rwc, maxResponseBytes))
+}
@@ -0,0 +1,89 @@
+package jsonrpc2
+
+import (
+	"errors"
+	"net/rpc"
+	"testing"
+)
+
+// fakeResettable lets a test control the generation a clientCodec sees
+// without a real transport underneath it.
+type fakeResettable struct {
+	gen int64
+}
+
+func (f *fakeResettable) Generation() int64 { return f.gen }
+
+// fakeRWC pairs a fakeResettable with just enough of io.ReadWriteCloser for
+// newClientCodec to accept it; Read is never expected to be reached by
+// these tests, since every pending call here is either an orphan (handled
+// without touching the wire) or left unread.
+type fakeRWC struct {
+	*fakeResettable
+}
+
+func (f *fakeRWC) Read(p []byte) (int, error) {
+	return 0, errors.New("jsonrpc2: test fakeRWC.Read called unexpectedly")
+}
+func (f *fakeRWC) Write(p []byte) (int, error) { return len(p), nil }
+func (f *fakeRWC) Close() error                { return nil }
+
+// A reconnect (bump in Generation) must fail every call that was written
+// before it, one per ReadResponseHeader call and in no particular order,
+// without touching the wire - that's what lets
+// Batch.Flush (and anything else waiting on rpc.Call.Done) observe an
+// explicit per-call error instead of hanging forever on a reply that the
+// new connection's peer has no way to produce.
+func TestReadResponseHeaderFailsCallsOrphanedByReconnect(t *testing.T) {
+	fr := &fakeResettable{}
+	c := newClientCodec(&fakeRWC{fr}, nil)
+
+	c.pending[1] = pendingCall{method: "get", generation: 0}
+	c.pending[2] = pendingCall{method: "set", generation: 0}
+
+	fr.gen = 1 // simulate a reconnect after both of the above were written
+	c.pending[3] = pendingCall{method: "delete", generation: 1}
+
+	got := map[uint64]string{}
+	for i := 0; i < 2; i++ {
+		var resp rpc.Response
+		if err := c.ReadResponseHeader(&resp); err != nil {
+			t.Fatalf("ReadResponseHeader: %v", err)
+		}
+		if resp.Error == "" {
+			t.Fatalf("expected an orphaned call to be reported as failed, got a clean response for seq %d", resp.Seq)
+		}
+		got[resp.Seq] = resp.ServiceMethod
+
+		if err := c.ReadResponseBody(nil); err != nil {
+			t.Fatalf("ReadResponseBody(nil) for orphaned call: %v", err)
+		}
+	}
+
+	want := map[uint64]string{1: "get", 2: "set"}
+	for seq, method := range want {
+		if got[seq] != method {
+			t.Errorf("seq %d: got method %q, want %q", seq, got[seq], method)
+		}
+	}
+
+	if _, stillPending := c.pending[1]; stillPending {
+		t.Error("orphaned call 1 should have been removed from pending")
+	}
+	if _, stillPending := c.pending[2]; stillPending {
+		t.Error("orphaned call 2 should have been removed from pending")
+	}
+	if _, stillPending := c.pending[3]; !stillPending {
+		t.Error("call 3, written under the current generation, should not have been orphaned")
+	}
+}
+
+func TestOrphanedReturnsFalseWithNoStaleGeneration(t *testing.T) {
+	fr := &fakeResettable{}
+	c := newClientCodec(&fakeRWC{fr}, nil)
+	c.pending[1] = pendingCall{method: "get", generation: 0}
+
+	if _, _, ok := c.orphaned(); ok {
+		t.Error("orphaned() should report nothing when no reconnect has happened")
+	}
+}
@@ -23,11 +23,14 @@ func update_collectors(m2m *xrm2m.M2MClient, collectors *[]Collector) {
 	// Indicate we're going to replace the whole subtree for this Policy
 	m2m.Replace(path_root)
 
-	// Set each collector's IP address and port
+	// Set each collector's IP address and port. There can be hundreds of
+	// these, so pipeline them in one batch rather than one round-trip apiece.
+	batch := m2m.Batch()
 	for _, collector := range *collectors {
 		key, _ := json.Marshal(collector)
-		m2m.Set(fmt.Sprintf("%s(%s)", path_root, key), true)
+		batch.Set(fmt.Sprintf("%s(%s)", path_root, key), true)
 	}
+	batch.Flush() // per-collector errors surface via m2m.Error/LastOp as usual
 
 	// For educational purposes, show what changes are about to be committed
 	xrm2m_util.PrintChanges(m2m)
@@ -0,0 +1,110 @@
+// xrm2m-gen turns a router's schema (from M2MClient.GetSchema) into a
+// typed, compile-time-safe Go path builder, instead of everyone hand-writing
+// stringly-typed paths like
+// "RootCfg.Telemetry.JSON.PolicyGroup(['main']).IPv4Address" and
+// hand-marshaling key structs the way update_collectors does today.
+//
+// Typical use is two runs: one against a live router with -dump to save its
+// schema to disk, and then as many offline -load runs as needed while
+// iterating on the generated code, since routers aren't always available
+// for every build.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"xrm2m"
+	"xrm2m/schema"
+	"xrm2m_util"
+)
+
+func main() {
+	host := flag.String("host", "", "router to connect to, host:22")
+	root := flag.String("root", "RootCfg", "schema path to walk from")
+	dumpTo := flag.String("dump", "", "if set, write the fetched schema as JSON here instead of generating code")
+	loadFrom := flag.String("load", "", "if set, generate from a schema previously written with -dump instead of a live router")
+	pkg := flag.String("package", "xrgen", "package name for the generated Go source")
+	out := flag.String("out", "", "output file for the generated Go source (default: stdout)")
+	flag.Parse()
+
+	if *dumpTo != "" {
+		dumpSchema(*host, *root, *dumpTo)
+		return
+	}
+
+	node := fetchNode(*host, *root, *loadFrom)
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := schema.Generate(w, *pkg, node); err != nil {
+		log.Fatal("Can't generate: " + err.Error())
+	}
+}
+
+func dumpSchema(host, root, dumpTo string) {
+	if host == "" {
+		log.Fatal("-host is required with -dump")
+	}
+
+	m2m, err := xrm2m.NewClient(host, xrm2m_util.CredsFromEnv())
+	if err != nil {
+		log.Fatal("Can't create M2M client session: " + err.Error())
+	}
+	defer m2m.Close()
+
+	raw := m2m.GetSchema(root, "")
+	if m2m.Error != nil {
+		log.Fatal("Can't fetch schema: " + m2m.Error.Error())
+	}
+
+	buf, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dumpTo, buf, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func fetchNode(host, root, loadFrom string) *schema.Node {
+	if loadFrom != "" {
+		buf, err := ioutil.ReadFile(loadFrom)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var node schema.Node
+		if err := json.Unmarshal(buf, &node); err != nil {
+			log.Fatal("Can't parse dumped schema: " + err.Error())
+		}
+		node.Name = root
+		return &node
+	}
+
+	if host == "" {
+		log.Fatal("Either -host or -load must be given")
+	}
+
+	m2m, err := xrm2m.NewClient(host, xrm2m_util.CredsFromEnv())
+	if err != nil {
+		log.Fatal("Can't create M2M client session: " + err.Error())
+	}
+	defer m2m.Close()
+
+	node, err := schema.Walk(m2m, root)
+	if err != nil {
+		log.Fatal("Can't fetch schema: " + err.Error())
+	}
+	return node
+}
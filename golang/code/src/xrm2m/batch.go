@@ -0,0 +1,108 @@
+// Pipelined bulk path operations for M2MClient.
+//
+// A script that replaces a large subtree one Set/Delete/Replace at a time
+// pays a full SSH round-trip per call. Batch accumulates a run of those
+// calls and flushes them pipelined - every request written before waiting on
+// any response - rather than one at a time. The demultiplexing of responses
+// back onto the right call, by request id, is already handled by the
+// underlying rpc.Client (see jsonrpc2.NewClient): its Go/Call plumbing is
+// exactly the id-correlated, mutex-protected, single-reader-goroutine
+// dispatcher this needs, so Batch is just a thin accumulator on top of it.
+//
+// This implements pipelining, not true JSON-RPC 2.0 array batching (one
+// request object containing all the calls) - there's no evidence the XR
+// M2M json_rpc_server understands the latter, and pipelining already gets
+// the round-trip-count win without relying on an unconfirmed server feature.
+//
+// If the SSH session reconnects while several ops are still in flight, the
+// new server process has no memory of the ones it never replied to; the
+// codec notices via XrSession.Generation and fails each of those calls
+// explicitly (see jsonrpc2.clientCodec.orphaned) rather than leaving Flush
+// waiting on a reply that will never come.
+
+package xrm2m
+
+import "net/rpc"
+
+type batchOp struct {
+	method string
+	args   []interface{}
+}
+
+// Batch accumulates Set/Delete/Replace calls to flush together. Get a Batch
+// via M2MClient.Batch.
+type Batch struct {
+	m2m *M2MClient
+	ops []batchOp
+}
+
+// BatchResult carries one error per operation submitted to a Batch, in the
+// same order they were added; a nil entry means that operation succeeded.
+type BatchResult struct {
+	Errors []error
+}
+
+// FirstError returns the first non-nil error in the result, or nil if every
+// operation succeeded.
+func (r *BatchResult) FirstError() error {
+	for _, err := range r.Errors {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Batch returns a handle for accumulating Set/Delete/Replace calls to flush
+// together.
+func (m2m *M2MClient) Batch() *Batch {
+	return &Batch{m2m: m2m}
+}
+
+func (b *Batch) Set(path string, value interface{}) {
+	b.ops = append(b.ops, batchOp{"set", []interface{}{"path", path, "value", value}})
+}
+
+func (b *Batch) Delete(path string) {
+	b.ops = append(b.ops, batchOp{"delete", []interface{}{"path", path}})
+}
+
+func (b *Batch) Replace(path string) {
+	b.ops = append(b.ops, batchOp{"replace", []interface{}{"path", path}})
+}
+
+// Flush pipelines every accumulated operation - writing each request before
+// waiting on any response - and returns once they've all completed. One
+// operation failing does not stop the others from being sent or reported.
+// m2m.Error/LastOp are also updated (to the first failure, if any) so code
+// relying on the sticky-error pattern keeps working unchanged.
+func (b *Batch) Flush() *BatchResult {
+	result := &BatchResult{Errors: make([]error, len(b.ops))}
+
+	if err := b.m2m.checkError(); err != nil {
+		for i := range result.Errors {
+			result.Errors[i] = err
+		}
+		b.ops = nil
+		return result
+	}
+
+	calls := make([]*rpc.Call, len(b.ops))
+	for i, op := range b.ops {
+		var reply interface{}
+		calls[i] = b.m2m.Go(op.method, make_request(op.args), &reply, make(chan *rpc.Call, 1))
+	}
+
+	noted := false
+	for i, call := range calls {
+		<-call.Done
+		result.Errors[i] = call.Error
+		if call.Error != nil && !noted {
+			b.m2m.noteResult(b.ops[i].method, call.Error)
+			noted = true
+		}
+	}
+
+	b.ops = nil
+	return result
+}
@@ -0,0 +1,145 @@
+package xrm2m
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"jsonrpc2"
+)
+
+// testRWC adapts one end of a net.Pipe into what jsonrpc2.NewClient wants:
+// an io.ReadWriteCloser that also satisfies jsonrpc2.Resettable, so
+// M2MClient can be built here without a real SSH session. Generation
+// always reports 0 - these tests aren't exercising reconnect behavior
+// (that's covered in package jsonrpc2), just the Error/LastOp contract
+// above it.
+type testRWC struct {
+	net.Conn
+}
+
+func (testRWC) Generation() int64 { return 0 }
+
+// newTestM2MClient builds an M2MClient wired to an in-process fake
+// json_rpc_server over a net.Pipe, without dialing anything.
+func newTestM2MClient() (*M2MClient, net.Conn) {
+	client, server := net.Pipe()
+	m2m := &M2MClient{mu: &sync.Mutex{}, timeout: DefaultCallTimeout}
+	m2m.Client = jsonrpc2.NewClient(testRWC{client}, &m2m.MaxResponseBytes)
+	return m2m, server
+}
+
+// runFakeServer answers "get" after a deliberate delay (so a short ctx
+// timeout always wins the race against it) and "set" with an immediate
+// JSON-RPC error (so Batch.Flush always sees a failure). It stops once the
+// pipe is closed out from under its Decoder.
+func runFakeServer(t *testing.T, conn net.Conn, getDelay time.Duration) {
+	t.Helper()
+	var writeMu sync.Mutex
+	write := func(v interface{}) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		json.NewEncoder(conn).Encode(v)
+	}
+
+	dec := json.NewDecoder(conn)
+	for {
+		var req struct {
+			Id     uint64 `json:"id"`
+			Method string `json:"method"`
+		}
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+
+		switch req.Method {
+		case "get":
+			go func(id uint64) {
+				time.Sleep(getDelay)
+				write(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": []interface{}{}})
+			}(req.Id)
+		case "set":
+			write(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      req.Id,
+				"error":   map[string]interface{}{"code": 1, "message": "simulated failure"},
+			})
+		default:
+			write(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": nil})
+		}
+	}
+}
+
+// A Batch.Flush latching m2m.Error and a concurrent GetContext timing out
+// against the same M2MClient used to race on the plain Error/LastOp fields
+// (confirmed with go test -race); both now go through a shared mutex. This
+// also checks that a ctx deadline, unlike Batch's real RPC failures, never
+// latches into the sticky Error.
+func TestConcurrentContextCallsAndBatchFlushDontRaceOnError(t *testing.T) {
+	m2m, server := newTestM2MClient()
+	defer server.Close()
+
+	go runFakeServer(t, server, 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+			defer cancel()
+			if _, err := m2m.GetContext(ctx, "/foo"); err != context.DeadlineExceeded {
+				t.Errorf("GetContext: got err %v, want context.DeadlineExceeded", err)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b := m2m.Batch()
+		for i := 0; i < 5; i++ {
+			b.Set("/bar", i)
+		}
+		if result := b.Flush(); result.FirstError() == nil {
+			t.Error("Flush: expected every op to fail, got no error")
+		}
+	}()
+
+	wg.Wait()
+
+	switch err := m2m.checkError(); {
+	case err == nil:
+		t.Error("m2m.Error should have latched Batch's failure")
+	case err == context.DeadlineExceeded:
+		t.Error("a ctx deadline must never latch into m2m.Error")
+	}
+}
+
+// A call whose context times out must not brick the client for later
+// unrelated calls the way a real RPC failure would.
+func TestContextTimeoutDoesNotPoisonLaterCalls(t *testing.T) {
+	m2m, server := newTestM2MClient()
+	defer server.Close()
+
+	go runFakeServer(t, server, 50*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := m2m.GetContext(ctx, "/foo"); err != context.DeadlineExceeded {
+		t.Fatalf("GetContext: got err %v, want context.DeadlineExceeded", err)
+	}
+
+	if err := m2m.checkError(); err != nil {
+		t.Fatalf("m2m.Error got poisoned by a ctx timeout: %v", err)
+	}
+
+	// A later call on the same client must still go through normally.
+	if _, err := m2m.GetChildrenContext(context.Background(), "/baz"); err != nil {
+		t.Fatalf("GetChildrenContext after an unrelated timeout: %v", err)
+	}
+}
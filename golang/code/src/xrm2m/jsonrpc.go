@@ -5,17 +5,49 @@
 package xrm2m
 
 import (
+	"context"
 	"jsonrpc2"
 	"net/rpc"
+	"sync"
+	"time"
 )
 
+// Default per-call timeout used by the *Context methods when the caller's
+// own context carries no deadline.
+const DefaultCallTimeout = 30 * time.Second
+
 // Represent an M2M client connection, plus error. If the Error is non-nil then
 // further operations will be skipped, and LastOp will contain the JSON-RPC
-// method that triggered the failure
+// method that triggered the failure.
+//
+// A single M2MClient is safe for concurrent use by multiple goroutines -
+// e.g. a Batch.Flush alongside one or more *Context calls - Error and LastOp
+// are guarded by an internal mutex rather than read or written directly.
 type M2MClient struct {
-	rpc.Client
+	*rpc.Client
 	Error  error
 	LastOp string
+
+	// MaxResponseBytes, if set above zero, hard-caps the cumulative size of
+	// any single response: further reads of an oversized response fail with
+	// an explicit error rather than growing without bound. Zero (the
+	// default) means unlimited. Safe to change at any time. Ordinary calls
+	// read it from the client that NewClient built for the connection; a
+	// clone made with WithTimeout holds its own copy, which only its
+	// GetStream uses.
+	MaxResponseBytes int64
+
+	host    string
+	creds   *Creds
+	session *XrSession
+	timeout time.Duration
+
+	// mu guards Error and LastOp. It's a pointer, not a plain sync.Mutex
+	// field, so that WithTimeout's shallow copy shares one mutex with the
+	// client it was cloned from instead of copying a lock value (which
+	// go vet rightly flags, the same way it would for a copied sync.Mutex
+	// embedded anywhere else).
+	mu *sync.Mutex
 }
 
 // Create a JSON-RPC over SSH client session for the XR M2M API
@@ -24,7 +56,75 @@ func NewClient(host string, creds *Creds) (*M2MClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &M2MClient{*jsonrpc2.NewClient(xrs), nil, ""}, nil
+	m2m := &M2MClient{
+		host:    host,
+		creds:   creds,
+		session: xrs,
+		timeout: DefaultCallTimeout,
+		mu:      &sync.Mutex{},
+	}
+	m2m.Client = jsonrpc2.NewClient(xrs, &m2m.MaxResponseBytes)
+	return m2m, nil
+}
+
+// NewClientWithTimeout is like NewClient, but overrides the default per-call
+// timeout applied by the *Context methods.
+func NewClientWithTimeout(host string, creds *Creds, timeout time.Duration) (*M2MClient, error) {
+	m2m, err := NewClient(host, creds)
+	if err != nil {
+		return nil, err
+	}
+	m2m.timeout = timeout
+	return m2m, nil
+}
+
+// WithTimeout returns a shallow copy of m2m whose *Context methods default
+// to timing a call out after d, for contexts that don't carry their own
+// deadline. The clone shares the same underlying *rpc.Client, session and
+// error-tracking mutex as m2m (cloning only copies pointers, not the
+// connection itself). Error, LastOp and MaxResponseBytes are copied by
+// value, though: a failure latched on the clone is not seen by m2m or the
+// other way round, and see MaxResponseBytes for which copy applies where.
+func (m2m *M2MClient) WithTimeout(d time.Duration) *M2MClient {
+	clone := *m2m
+	clone.timeout = d
+	return &clone
+}
+
+// checkError returns the sticky error, if any, under the same lock that
+// guards every write to it.
+func (m2m *M2MClient) checkError() error {
+	m2m.mu.Lock()
+	defer m2m.mu.Unlock()
+	return m2m.Error
+}
+
+// noteResult records the outcome of a call: LastOp is always updated, but
+// Error only ever latches the *first* failure - once set, it isn't cleared
+// or overwritten by a later call's result, matching the single sticky Error
+// the type's doc comment promises.
+func (m2m *M2MClient) noteResult(method string, err error) {
+	m2m.mu.Lock()
+	defer m2m.mu.Unlock()
+	m2m.LastOp = method
+	if err != nil && m2m.Error == nil {
+		m2m.Error = err
+	}
+}
+
+// noteContextResult is like noteResult, but never latches a context
+// cancellation or deadline into Error: that's the caller's own timing
+// decision, not evidence that the session or protocol is broken, so unlike
+// a real RPC/transport failure it must not gate every later call on this
+// client.
+func (m2m *M2MClient) noteContextResult(method string, err error) {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		m2m.mu.Lock()
+		m2m.LastOp = method
+		m2m.mu.Unlock()
+		return
+	}
+	m2m.noteResult(method, err)
 }
 
 //
@@ -90,6 +190,81 @@ func (m2m *M2MClient) GetChanges() []map[string]interface{} {
 	return m2m.call_for_array_of_objects("get_changes")
 }
 
+// CommitConfirmed is like Commit, but automatically rolls the commit back
+// unless the returned confirm closure is called within timeout - the usual
+// safety net for a commit that might break management reachability.
+//
+// The XR M2M API exposed through this client has no native confirmed-commit
+// RPC, so the timer is implemented client-side: the pending changes are
+// snapshotted via GetChanges, the commit is applied, and a watchdog goroutine
+// restores the snapshot with CommitReplace if confirm hasn't been called by
+// the time timeout elapses. The watchdog does this over its own, separate
+// M2MClient (a second SSH session to the same host) rather than reaching
+// into m2m, since the caller is expected to go on using m2m concurrently
+// during the confirm window; sharing it with a background goroutine would
+// race on m2m.Error/LastOp, and could silently defeat the rollback if the
+// caller's own use of m2m happened to set m2m.Error first. Calling confirm
+// after the watchdog has already started rolling back will simply wait for
+// that rollback to finish. If the router is unreachable when the watchdog
+// fires, there is no server-side timer backing this up, so nothing will roll
+// back automatically; routers with a native commit-confirmed RPC should
+// prefer that instead.
+func (m2m *M2MClient) CommitConfirmed(comment, label string, timeout time.Duration) (commitID string, confirm func() error, err error) {
+	if err := m2m.checkError(); err != nil {
+		return "", nil, err
+	}
+
+	snapshot := m2m.GetChanges()
+	if err := m2m.checkError(); err != nil {
+		return "", nil, err
+	}
+
+	commitID = m2m.Commit(comment, label)
+	if err := m2m.checkError(); err != nil {
+		return "", nil, err
+	}
+
+	var once sync.Once
+	rollback := func() {
+		once.Do(func() {
+			watchdog, err := NewClient(m2m.host, m2m.creds)
+			if err != nil {
+				return // can't roll back without a session; nothing more to do
+			}
+			defer watchdog.Close()
+			watchdog.rollbackToSnapshot(snapshot)
+		})
+	}
+
+	timer := time.AfterFunc(timeout, rollback)
+
+	confirm = func() error {
+		timer.Stop()
+		once.Do(func() {}) // mark confirmed so a racing rollback becomes a no-op
+		return nil
+	}
+
+	return commitID, confirm, nil
+}
+
+// rollbackToSnapshot restores the pending config changes captured by an
+// earlier GetChanges and force-commits them, undoing whatever got committed
+// in between.
+func (m2m *M2MClient) rollbackToSnapshot(changes []map[string]interface{}) {
+	for _, change := range changes {
+		path, _ := change["path"].(string)
+		if path == "" {
+			continue
+		}
+		if oldValue, ok := change["old_value"]; ok {
+			m2m.Set(path, oldValue)
+		} else {
+			m2m.Delete(path)
+		}
+	}
+	m2m.CommitReplace("confirmed-commit rollback", "")
+}
+
 // Schema inspection
 
 func (m2m *M2MClient) GetSchema(path, fields string) map[string]interface{} {
@@ -104,57 +279,130 @@ func (m2m *M2MClient) GetVersion() map[string]interface{} {
 	return m2m.call_for_object("get_version")
 }
 
+//
+// Context variants. These cancel the outstanding JSON-RPC call when ctx is
+// done, rather than blocking forever, and return the error instead of
+// stashing it only in m2m.Error. A ctx cancellation/timeout does update
+// LastOp, but - unlike a real RPC or transport failure - never latches into
+// the sticky Error, since it reflects the caller's own timing choice rather
+// than evidence the session is broken; the two styles can still be mixed
+// freely on the same M2MClient.
+//
+
+func (m2m *M2MClient) CliExecContext(ctx context.Context, command string) (string, error) {
+	return m2m.call_for_string_context(ctx, "cli_exec", "command", command)
+}
+
+func (m2m *M2MClient) CliGetContext(ctx context.Context, command string) ([][]interface{}, error) {
+	return m2m.call_for_array_of_arrays_context(ctx, "cli_get", "command", command)
+}
+
+func (m2m *M2MClient) CliSetContext(ctx context.Context, command string) error {
+	return m2m.call_for_void_context(ctx, "cli_set", "command", command)
+}
+
+func (m2m *M2MClient) WriteFileContext(ctx context.Context, filename string, data []byte) error {
+	return m2m.call_for_void_context(ctx, "write_file", "filename", filename, "data", string(data))
+}
+
+func (m2m *M2MClient) GetContext(ctx context.Context, path string) ([][]interface{}, error) {
+	return m2m.call_for_array_of_arrays_context(ctx, "get", "path", path)
+}
+
+func (m2m *M2MClient) GetChildrenContext(ctx context.Context, path string) ([]string, error) {
+	return m2m.call_for_string_array_context(ctx, "get_children", "path", path)
+}
+
+func (m2m *M2MClient) SetContext(ctx context.Context, path string, value interface{}) error {
+	return m2m.call_for_void_context(ctx, "set", "path", path, "value", value)
+}
+
+func (m2m *M2MClient) DeleteContext(ctx context.Context, path string) error {
+	return m2m.call_for_void_context(ctx, "delete", "path", path)
+}
+
+func (m2m *M2MClient) ReplaceContext(ctx context.Context, path string) error {
+	return m2m.call_for_void_context(ctx, "replace", "path", path)
+}
+
+func (m2m *M2MClient) CommitContext(ctx context.Context, comment, label string) (string, error) {
+	return m2m.call_for_optional_string_context(ctx, "commit", "comment", comment, "label", label)
+}
+
+func (m2m *M2MClient) CommitReplaceContext(ctx context.Context, comment, label string) (string, error) {
+	return m2m.call_for_optional_string_context(ctx, "commit_replace", "comment", comment, "label", label)
+}
+
+func (m2m *M2MClient) DiscardChangesContext(ctx context.Context) error {
+	return m2m.call_for_void_context(ctx, "discard_changes")
+}
+
+func (m2m *M2MClient) GetChangesContext(ctx context.Context) ([]map[string]interface{}, error) {
+	return m2m.call_for_array_of_objects_context(ctx, "get_changes")
+}
+
+func (m2m *M2MClient) GetSchemaContext(ctx context.Context, path, fields string) (map[string]interface{}, error) {
+	if fields != "" {
+		return m2m.call_for_object_context(ctx, "get_schema", "path", path, "fields", fields)
+	}
+	return m2m.call_for_object_context(ctx, "get_schema", "path", path)
+}
+
+func (m2m *M2MClient) GetVersionContext(ctx context.Context) (map[string]interface{}, error) {
+	return m2m.call_for_object_context(ctx, "get_version")
+}
+
 // ---------------------------------------------------------------------------
 
 // Helper functions to wrap individal APIs
 
 func (m2m *M2MClient) call_for_array_of_arrays(method string, args ...interface{}) [][]interface{} {
-	if m2m.Error != nil {
+	if m2m.checkError() != nil {
 		return nil
 	}
 	var reply [][]interface{}
-	m2m.Error = m2m.Call(method, make_request(args), &reply)
-	m2m.LastOp = method
+	err := m2m.Call(method, make_request(args), &reply)
+	m2m.noteResult(method, err)
 	return reply
 }
 
 func (m2m *M2MClient) call_for_object(method string, args ...interface{}) map[string]interface{} {
-	if m2m.Error != nil {
+	if m2m.checkError() != nil {
 		return nil
 	}
 	var reply map[string]interface{}
-	m2m.Error = m2m.Call(method, make_request(args), &reply)
-	m2m.LastOp = method
+	err := m2m.Call(method, make_request(args), &reply)
+	m2m.noteResult(method, err)
 	return reply
 }
 
 func (m2m *M2MClient) call_for_array_of_objects(method string, args ...interface{}) []map[string]interface{} {
-	if m2m.Error != nil {
+	if m2m.checkError() != nil {
 		return nil
 	}
 	var reply []map[string]interface{}
-	m2m.Error = m2m.Call(method, make_request(args), &reply)
-	m2m.LastOp = method
+	err := m2m.Call(method, make_request(args), &reply)
+	m2m.noteResult(method, err)
 	return reply
 }
 
 func (m2m *M2MClient) call_for_string(method string, args ...interface{}) string {
-	if m2m.Error != nil {
+	if m2m.checkError() != nil {
 		return ""
 	}
 	var reply string
-	m2m.Error = m2m.Call(method, make_request(args), &reply)
-	m2m.LastOp = method
+	err := m2m.Call(method, make_request(args), &reply)
+	m2m.noteResult(method, err)
 	return reply
 }
 
 func (m2m *M2MClient) call_for_optional_string(method string, args ...interface{}) string {
-	if m2m.Error != nil {
+	if m2m.checkError() != nil {
 		return ""
 	}
 	var reply *string
-	m2m.Error = m2m.Call(method, make_request(args), &reply)
-	m2m.LastOp = method
+	err := m2m.Call(method, make_request(args), &reply)
+	m2m.noteResult(method, err)
 	if reply == nil {
 		return ""
 	} else {
@@ -163,22 +411,147 @@ func (m2m *M2MClient) call_for_optional_string(method string, args ...interface{
 }
 
 func (m2m *M2MClient) call_for_string_array(method string, args ...interface{}) []string {
-	if m2m.Error != nil {
+	if m2m.checkError() != nil {
 		return nil
 	}
 	var reply []string
-	m2m.Error = m2m.Call(method, make_request(args), &reply)
-	m2m.LastOp = method
+	err := m2m.Call(method, make_request(args), &reply)
+	m2m.noteResult(method, err)
 	return reply
 }
 
 func (m2m *M2MClient) call_for_void(method string, args ...interface{}) {
-	if m2m.Error != nil {
+	if m2m.checkError() != nil {
 		return
 	}
 	var reply interface{}
-	m2m.Error = m2m.Call(method, make_request(args), &reply)
-	m2m.LastOp = method
+	err := m2m.Call(method, make_request(args), &reply)
+	m2m.noteResult(method, err)
+}
+
+// Context-aware helpers, paralleling the call_for_* family above. Each
+// issues the call asynchronously via rpc.Client.Go and races it against
+// ctx, falling back to m2m.timeout if ctx has no deadline of its own.
+//
+// A cancellation only stops this goroutine from waiting - it deliberately
+// does not touch the shared session. The underlying connection serves every
+// in-flight call on this M2MClient (other Context calls, a Batch.Flush),
+// so tearing it down to unstick one cancelled call would fail all of those
+// too. The call channel is buffered by one specifically so the eventual,
+// unwanted reply (if any ever arrives) can be delivered without blocking
+// rpc.Client's reader goroutine; it's simply never read again.
+//
+// do_call_context reports completed=false when ctx fires before call.Done
+// does. Callers must not read their reply argument in that case: net/rpc's
+// reader goroutine may still be about to decode a late response into it,
+// so returning it (or even just reading it to build a return value) races
+// against that write.
+func (m2m *M2MClient) do_call_context(ctx context.Context, method string, request *map[string]interface{}, reply interface{}) (completed bool, err error) {
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline && m2m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m2m.timeout)
+		defer cancel()
+	}
+
+	call := m2m.Go(method, request, reply, make(chan *rpc.Call, 1))
+
+	select {
+	case <-call.Done:
+		return true, call.Error
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func (m2m *M2MClient) call_for_array_of_arrays_context(ctx context.Context, method string, args ...interface{}) ([][]interface{}, error) {
+	if err := m2m.checkError(); err != nil {
+		return nil, err
+	}
+	var reply [][]interface{}
+	completed, err := m2m.do_call_context(ctx, method, make_request(args), &reply)
+	m2m.noteContextResult(method, err)
+	if !completed {
+		return nil, err
+	}
+	return reply, err
+}
+
+func (m2m *M2MClient) call_for_object_context(ctx context.Context, method string, args ...interface{}) (map[string]interface{}, error) {
+	if err := m2m.checkError(); err != nil {
+		return nil, err
+	}
+	var reply map[string]interface{}
+	completed, err := m2m.do_call_context(ctx, method, make_request(args), &reply)
+	m2m.noteContextResult(method, err)
+	if !completed {
+		return nil, err
+	}
+	return reply, err
+}
+
+func (m2m *M2MClient) call_for_array_of_objects_context(ctx context.Context, method string, args ...interface{}) ([]map[string]interface{}, error) {
+	if err := m2m.checkError(); err != nil {
+		return nil, err
+	}
+	var reply []map[string]interface{}
+	completed, err := m2m.do_call_context(ctx, method, make_request(args), &reply)
+	m2m.noteContextResult(method, err)
+	if !completed {
+		return nil, err
+	}
+	return reply, err
+}
+
+func (m2m *M2MClient) call_for_string_context(ctx context.Context, method string, args ...interface{}) (string, error) {
+	if err := m2m.checkError(); err != nil {
+		return "", err
+	}
+	var reply string
+	completed, err := m2m.do_call_context(ctx, method, make_request(args), &reply)
+	m2m.noteContextResult(method, err)
+	if !completed {
+		return "", err
+	}
+	return reply, err
+}
+
+func (m2m *M2MClient) call_for_optional_string_context(ctx context.Context, method string, args ...interface{}) (string, error) {
+	if err := m2m.checkError(); err != nil {
+		return "", err
+	}
+	var reply *string
+	completed, err := m2m.do_call_context(ctx, method, make_request(args), &reply)
+	m2m.noteContextResult(method, err)
+	if !completed {
+		return "", err
+	}
+	if reply == nil {
+		return "", err
+	}
+	return *reply, err
+}
+
+func (m2m *M2MClient) call_for_string_array_context(ctx context.Context, method string, args ...interface{}) ([]string, error) {
+	if err := m2m.checkError(); err != nil {
+		return nil, err
+	}
+	var reply []string
+	completed, err := m2m.do_call_context(ctx, method, make_request(args), &reply)
+	m2m.noteContextResult(method, err)
+	if !completed {
+		return nil, err
+	}
+	return reply, err
+}
+
+func (m2m *M2MClient) call_for_void_context(ctx context.Context, method string, args ...interface{}) error {
+	if err := m2m.checkError(); err != nil {
+		return err
+	}
+	var reply interface{}
+	_, err := m2m.do_call_context(ctx, method, make_request(args), &reply)
+	m2m.noteContextResult(method, err)
+	return err
 }
 
 func make_request(args []interface{}) *map[string]interface{} {
@@ -0,0 +1,178 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Generate walks root and writes Go source for a compile-time-safe path
+// builder over it to w: one struct type per schema node, a top-level var to
+// start building paths from (named after root), String() methods on leaves
+// that produce the exact path literal the router expects, and Set methods
+// that validate a leaf's declared type (via CheckType) before handing the
+// value to M2MClient.Set. A node with keys (a list, or a leaf that's really
+// a keyed set of leaves, like PolicyGroup or IPv4Address in
+// RootCfg.Telemetry.JSON.PolicyGroup(['main']).IPv4Address(...)) gets a
+// generated <Type>Key struct and is reached via a method that takes one,
+// rather than a plain field.
+//
+// This is a straight recursive walk emitting text, not a text/template -
+// that keeps the mapping from schema node to generated code easy to follow
+// and tweak.
+func Generate(w io.Writer, packageName string, root *Node) error {
+	g := &generator{w: w}
+	g.printf("// Code generated by xrm2m-gen from GetSchema(%q). DO NOT EDIT.\n\n", root.Name)
+	g.printf("package %s\n\n", packageName)
+	g.printf("import (\n\t\"encoding/json\"\n\t\"fmt\"\n\n\t\"xrm2m\"\n\t\"xrm2m/schema\"\n)\n\n")
+
+	rootType := g.emitNode(root.Name, root)
+
+	g.printf("// %s is where path building starts; chain fields and methods onto it\n", root.Name)
+	g.printf("// the same way the schema itself is laid out, e.g. %s.Telemetry.JSON....\n", root.Name)
+	g.printf("var %s = new%s(%q)\n", root.Name, rootType, root.Name)
+
+	return g.err
+}
+
+type generator struct {
+	w   io.Writer
+	err error
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	if g.err != nil {
+		return
+	}
+	_, g.err = fmt.Fprintf(g.w, format, args...)
+}
+
+// emitNode emits the struct (and, for a keyed node, its key struct) for
+// node and all its descendants, and returns the Go type name it used.
+func (g *generator) emitNode(path string, node *Node) string {
+	typ := typeName(path)
+
+	if len(node.Keys) > 0 {
+		g.emitKeyStruct(typ, node.Keys)
+	}
+
+	if node.NodeType == "leaf" {
+		g.emitLeaf(typ, node)
+		return typ
+	}
+
+	g.emitContainer(path, typ, node)
+	return typ
+}
+
+func (g *generator) emitKeyStruct(typ string, keys []KeyField) {
+	g.printf("type %sKey struct {\n", typ)
+	for _, k := range keys {
+		g.printf("\t%s %s `json:%q`\n", exportName(k.Name), goType(k.Type), k.Name)
+	}
+	g.printf("}\n\n")
+}
+
+func (g *generator) emitLeaf(typ string, node *Node) {
+	g.printf("type %s struct {\n\tpath string\n}\n\n", typ)
+	g.printf("func new%s(path string) *%s {\n\treturn &%s{path: path}\n}\n\n", typ, typ, typ)
+
+	g.printf("// String returns the exact path literal the router expects.\n")
+	g.printf("func (p *%s) String() string {\n\treturn p.path\n}\n\n", typ)
+
+	g.printf("// Set validates value against this leaf's declared schema type, then sets it.\n")
+	g.printf("func (p *%s) Set(m2m *xrm2m.M2MClient, value interface{}) error {\n", typ)
+	g.printf("\tif err := schema.CheckType(%q, value); err != nil {\n\t\treturn err\n\t}\n", node.LeafType)
+	g.printf("\tm2m.Set(p.path, value)\n\treturn m2m.Error\n}\n\n")
+}
+
+func (g *generator) emitContainer(path, typ string, node *Node) {
+	names := make([]string, 0, len(node.Children))
+	for name := range node.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	g.printf("type %s struct {\n\tpath string\n", typ)
+	for _, name := range names {
+		if len(node.Children[name].Keys) == 0 {
+			g.printf("\t%s *%s\n", exportName(name), typeName(path+"."+name))
+		}
+	}
+	g.printf("}\n\n")
+
+	g.printf("func new%s(path string) *%s {\n\treturn &%s{\n\t\tpath: path,\n", typ, typ, typ)
+	for _, name := range names {
+		if len(node.Children[name].Keys) == 0 {
+			childType := typeName(path + "." + name)
+			g.printf("\t\t%s: new%s(path + %q),\n", exportName(name), childType, "."+name)
+		}
+	}
+	g.printf("\t}\n}\n\n")
+
+	for _, name := range names {
+		child := node.Children[name]
+		if len(child.Keys) == 0 {
+			continue
+		}
+		childType := typeName(path + "." + name)
+		g.printf("func (p *%s) %s(key %sKey) *%s {\n", typ, exportName(name), childType, childType)
+		g.printf("\tkeyJSON, _ := json.Marshal(key)\n")
+		g.printf("\treturn new%s(fmt.Sprintf(\"%%s(%%s)\", p.path+%q, keyJSON))\n", childType, "."+name)
+		g.printf("}\n\n")
+	}
+
+	for _, name := range names {
+		g.emitNode(path+"."+name, node.Children[name])
+	}
+}
+
+// typeName derives a unique, exported Go type name from a dotted schema
+// path, e.g. "RootCfg.Telemetry.JSON" -> "RootCfgTelemetryJSONPath". The
+// "Path" suffix keeps every generated type name distinct from the plain
+// identifier Generate uses for the root var (itself named after root.Name),
+// which would otherwise collide with the root's own type for any path whose
+// derived name is already an exported identifier, as root.Name usually is.
+func typeName(path string) string {
+	var b strings.Builder
+	upperNext := true
+	for _, r := range path {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if upperNext {
+				r = unicode.ToUpper(r)
+				upperNext = false
+			}
+			b.WriteRune(r)
+		default:
+			upperNext = true
+		}
+	}
+	name := b.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "T" + name
+	}
+	return name + "Path"
+}
+
+func exportName(name string) string {
+	if name == "" {
+		return name
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+func goType(schemaType string) string {
+	switch schemaType {
+	case "int":
+		return "int"
+	case "bool":
+		return "bool"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,34 @@
+package schema
+
+import "fmt"
+
+// CheckType reports an error if value isn't the Go type that leafType
+// (one of the schema's own type names, e.g. "string", "int", "bool")
+// implies. Generated Set methods call this before handing value to
+// M2MClient.Set, so a typed path catches a mismatched value at the call
+// site instead of however the router's json_rpc_server happens to react to
+// it.
+func CheckType(leafType string, value interface{}) error {
+	want := ""
+	ok := false
+
+	switch leafType {
+	case "string":
+		_, ok = value.(string)
+		want = "string"
+	case "int":
+		_, ok = value.(int)
+		want = "int"
+	case "bool":
+		_, ok = value.(bool)
+		want = "bool"
+	default:
+		// Unrecognized leaf type in the schema; nothing to check against.
+		return nil
+	}
+
+	if !ok {
+		return fmt.Errorf("schema: expected a %s value for a %q leaf, got %T", want, leafType, value)
+	}
+	return nil
+}
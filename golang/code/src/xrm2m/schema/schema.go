@@ -0,0 +1,57 @@
+// Package schema turns the schema tree an XR router returns from
+// M2MClient.GetSchema into a typed representation, and (see generate.go)
+// into generated Go source for a compile-time-safe path builder over it.
+// xrm2m-gen is the command-line front end that ties this to a live router
+// or a schema dumped to disk.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"xrm2m"
+)
+
+// Node is one node of a router's schema tree, as returned by GetSchema.
+type Node struct {
+	Name     string           `json:"name"`
+	NodeType string           `json:"node_type"`        // "container", "list", or "leaf"
+	LeafType string           `json:"type,omitempty"`   // e.g. "string", "int", "bool"; set when NodeType == "leaf"
+	Keys     []KeyField       `json:"keys,omitempty"`   // set when NodeType == "list"
+	Children map[string]*Node `json:"children,omitempty"`
+}
+
+// KeyField describes one field of a list node's key.
+type KeyField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Parse converts the generic map returned by GetSchema into a typed Node
+// tree. It round-trips through JSON, which is the simplest way to apply the
+// struct tags above to router-supplied data of otherwise unknown shape.
+func Parse(raw map[string]interface{}) (*Node, error) {
+	buf, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("schema: can't re-marshal schema: %v", err)
+	}
+	var node Node
+	if err := json.Unmarshal(buf, &node); err != nil {
+		return nil, fmt.Errorf("schema: can't parse schema: %v", err)
+	}
+	return &node, nil
+}
+
+// Walk fetches the schema tree rooted at path and parses it.
+func Walk(m2m *xrm2m.M2MClient, path string) (*Node, error) {
+	raw := m2m.GetSchema(path, "")
+	if m2m.Error != nil {
+		return nil, m2m.Error
+	}
+	node, err := Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	node.Name = path
+	return node, nil
+}
@@ -8,6 +8,8 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"math/rand"
+	"sync"
 	"time"
 
 	// normal ssh doesn't support aes128-cbc
@@ -20,24 +22,88 @@ type Creds struct {
 	User        string
 	Password    string
 	Keypathname string
+
+	// How often to probe the connection with an SSH keepalive request, and
+	// thereby notice a dead connection in time to transparently reconnect.
+	// Zero means use the default of 30s; a negative value disables
+	// keepalives, though a Read or Write that fails still reconnects.
+	KeepAliveInterval time.Duration
 }
 
+const (
+	defaultKeepAliveInterval = 30 * time.Second
+	reconnectInitialBackoff  = 1 * time.Second
+	reconnectMaxBackoff      = 60 * time.Second
+	reconnectMaxElapsed      = 10 * time.Minute
+)
+
 // Represent running a long-lived command on an XR router over SSH
-// as a ReadWriteCloser
+// as a ReadWriteCloser.
+//
+// A background goroutine keeps the connection alive with periodic SSH
+// keepalive probes. If a probe fails, or a Read/Write otherwise turns up a
+// dead connection, the session transparently redials and re-runs cmd.
+// Whatever requests were in flight at the time are not replayed - the new
+// cmd process starts with no memory of them - so Generation lets a layer
+// that tracks its own in-flight requests (jsonrpc2's codec) notice that a
+// reconnect happened while they were outstanding and fail them explicitly,
+// rather than waiting forever for responses that will never arrive.
+// Callers just keep calling Read/Write as normal; those calls block (on a
+// condition variable, not a sleep-poll) until the session is healthy again
+// rather than returning a transient error.
 type XrSession struct {
-	session *ssh.Session
-	stdin   *io.WriteCloser
-	stdout  *io.Reader
-	ready   bool
+	host  string
+	cmd   string
+	creds *Creds
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	client       *ssh.Client
+	session      *ssh.Session
+	stdin        io.WriteCloser
+	stdout       io.Reader
+	reconnecting bool
+	closed       bool
+	fatalErr     error // set once reconnect gives up for good
+	generation   int64 // incremented each time reconnect() successfully redials
+}
+
+// Generation returns a counter that increments every time the session has
+// successfully reconnected. A caller that remembers the generation in
+// effect when it wrote a request can tell, by comparing against the
+// current value, whether a reconnect happened (and so its request's bytes
+// are gone) before a reply showed up.
+func (xrs *XrSession) Generation() int64 {
+	xrs.mu.Lock()
+	defer xrs.mu.Unlock()
+	return xrs.generation
 }
 
 // Create an SSH session that can connect to an XR router and run one
 // potentially long-lived command, interacting over stdin/stdout
 func NewXrSession(host string, creds *Creds, cmd string) (*XrSession, error) {
-	auth, err := get_auth(creds)
+	xrs := &XrSession{host: host, cmd: cmd, creds: creds}
+	xrs.cond = sync.NewCond(&xrs.mu)
+
+	client, session, stdin, stdout, err := dial_xr(host, creds, cmd)
 	if err != nil {
 		return nil, err
 	}
+	xrs.client, xrs.session, xrs.stdin, xrs.stdout = client, session, stdin, stdout
+
+	go xrs.keep_alive_loop()
+
+	return xrs, nil
+}
+
+// Dial the router, start cmd, and swallow the preamble of a couple of
+// blank lines and a date. Used both for the initial connect and for every
+// reconnect attempt.
+func dial_xr(host string, creds *Creds, cmd string) (*ssh.Client, *ssh.Session, io.WriteCloser, io.Reader, error) {
+	auth, err := get_auth(creds)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
 	sshConfig := &ssh.ClientConfig{
 		User:   creds.User,
 		Auth:   auth,
@@ -46,47 +112,43 @@ func NewXrSession(host string, creds *Creds, cmd string) (*XrSession, error) {
 
 	client, err := ssh.Dial("tcp", host, sshConfig)
 	if err != nil {
-		return nil, errors.New("Can't connect: " + err.Error())
+		return nil, nil, nil, nil, errors.New("Can't connect: " + err.Error())
 	}
 
 	session, err := client.NewSession()
 	if err != nil {
-		return nil, errors.New("Can't create session: " + err.Error())
+		client.Close()
+		return nil, nil, nil, nil, errors.New("Can't create session: " + err.Error())
 	}
 
 	stdin, err := session.StdinPipe()
 	if err != nil {
-		return nil, errors.New("Can't create stdin pipe: " + err.Error())
+		session.Close()
+		client.Close()
+		return nil, nil, nil, nil, errors.New("Can't create stdin pipe: " + err.Error())
 	}
 
 	stdout, err := session.StdoutPipe()
 	if err != nil {
-		return nil, errors.New("Can't create stdout pipe: " + err.Error())
+		session.Close()
+		client.Close()
+		return nil, nil, nil, nil, errors.New("Can't create stdout pipe: " + err.Error())
 	}
 
-	err = session.Start(cmd)
-	if err != nil {
-		return nil, errors.New("Can't start command: " + err.Error())
+	if err := session.Start(cmd); err != nil {
+		session.Close()
+		client.Close()
+		return nil, nil, nil, nil, errors.New("Can't start command: " + err.Error())
 	}
 
-	xrsession := &XrSession{
-		session: session,
-		stdin:   &stdin,
-		stdout:  &stdout,
-		ready:   false,
+	buf := make([]byte, 128) // just needs to be big enough
+	if _, err := stdout.Read(buf); err != nil {
+		session.Close()
+		client.Close()
+		return nil, nil, nil, nil, errors.New("Can't read preamble: " + err.Error())
 	}
 
-	// Swallow the preamble of a couple of blank lines and a date
-	go func() {
-		buf := make([]byte, 128) // just needs to be big enough
-		_, err := stdout.Read(buf)
-		if err != nil {
-			panic("Can't read preamble: " + err.Error())
-		}
-		xrsession.ready = true
-	}()
-
-	return xrsession, nil
+	return client, session, stdin, stdout, nil
 }
 
 // Convert simplified credentials into something useful for the ssh package
@@ -117,23 +179,173 @@ func get_auth(creds *Creds) ([]ssh.AuthMethod, error) {
 	return auth, nil
 }
 
-// Handle the ReadWriteCloser semantics. We cheesily block if asked to do
-// something before the session itself is fully up, but this is at worst
-// only a very transient thing right when the session is being established.
+// Send periodic keepalive requests down the SSH connection, and kick off a
+// reconnect as soon as one of them fails to get a response.
+func (xrs *XrSession) keep_alive_loop() {
+	interval := defaultKeepAliveInterval
+	switch {
+	case xrs.creds.KeepAliveInterval < 0:
+		return // keepalives disabled; Read/Write failures still reconnect
+	case xrs.creds.KeepAliveInterval > 0:
+		interval = xrs.creds.KeepAliveInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		xrs.mu.Lock()
+		if xrs.closed {
+			xrs.mu.Unlock()
+			return
+		}
+		client := xrs.client
+		reconnecting := xrs.reconnecting
+		xrs.mu.Unlock()
+
+		if reconnecting || client == nil {
+			continue
+		}
+
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			xrs.mu.Lock()
+			if !xrs.closed && !xrs.reconnecting {
+				xrs.reconnect()
+			}
+			xrs.mu.Unlock()
+		}
+	}
+}
+
+// Redial and restart cmd, with exponential backoff and jitter. Must be
+// called with mu held; it releases and reacquires mu while actually dialing.
+func (xrs *XrSession) reconnect() {
+	xrs.reconnecting = true
+	xrs.cond.Broadcast()
+
+	backoff := reconnectInitialBackoff
+	deadline := time.Now().Add(reconnectMaxElapsed)
+
+	for {
+		if xrs.closed {
+			xrs.reconnecting = false
+			xrs.fatalErr = errors.New("xrm2m: session closed while reconnecting")
+			xrs.cond.Broadcast()
+			return
+		}
+
+		host, creds, cmd := xrs.host, xrs.creds, xrs.cmd
+		xrs.mu.Unlock()
+
+		client, session, stdin, stdout, err := dial_xr(host, creds, cmd)
+
+		xrs.mu.Lock()
+
+		if err == nil {
+			xrs.client, xrs.session, xrs.stdin, xrs.stdout = client, session, stdin, stdout
+			xrs.generation++
+			xrs.reconnecting = false
+			xrs.cond.Broadcast()
+			return
+		}
+
+		if time.Now().After(deadline) {
+			xrs.reconnecting = false
+			xrs.fatalErr = errors.New("xrm2m: giving up reconnecting to " + xrs.host + ": " + err.Error())
+			xrs.cond.Broadcast()
+			return
+		}
+
+		// Exponential backoff, capped, with full jitter.
+		wait := time.Duration(rand.Int63n(int64(backoff)))
+		xrs.mu.Unlock()
+		time.Sleep(wait)
+		xrs.mu.Lock()
+
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
+
+// Handle the ReadWriteCloser semantics. Read/Write block on a condition
+// variable while a reconnect is in progress, rather than sleep-polling, and
+// transparently retry against the new connection once it's back.
 func (xrs *XrSession) Read(p []byte) (n int, err error) {
-	for !xrs.ready {
-		time.Sleep(100 * time.Millisecond)
+	for {
+		xrs.mu.Lock()
+		for xrs.reconnecting {
+			xrs.cond.Wait()
+		}
+		if xrs.fatalErr != nil {
+			fatalErr := xrs.fatalErr
+			xrs.mu.Unlock()
+			return 0, fatalErr
+		}
+		stdout := xrs.stdout
+		xrs.mu.Unlock()
+
+		n, err = stdout.Read(p)
+		if err == nil {
+			return n, nil
+		}
+
+		xrs.mu.Lock()
+		if !xrs.closed && !xrs.reconnecting {
+			xrs.reconnect()
+		}
+		xrs.mu.Unlock()
+		// loop around: wait for the reconnect and retry the read on the new stream
 	}
-	return (*xrs.stdout).Read(p)
 }
 
+// Write does not retry p itself after a reconnect: the new cmd process has
+// no memory of anything written to the old one, so replaying it here would
+// either be silently wrong (a "set" landing twice) or pointless (a response
+// to it will never come). It reports the write as failed so the caller -
+// and, via Generation, the jsonrpc2 codec - can tell that whatever request
+// this was needs to be resent as a new call rather than assumed in flight.
 func (xrs *XrSession) Write(p []byte) (n int, err error) {
-	for !xrs.ready {
-		time.Sleep(100 * time.Millisecond)
+	xrs.mu.Lock()
+	for xrs.reconnecting {
+		xrs.cond.Wait()
 	}
-	return (*xrs.stdin).Write(p)
+	if xrs.fatalErr != nil {
+		fatalErr := xrs.fatalErr
+		xrs.mu.Unlock()
+		return 0, fatalErr
+	}
+	stdin := xrs.stdin
+	xrs.mu.Unlock()
+
+	n, err = stdin.Write(p)
+	if err == nil {
+		return n, nil
+	}
+
+	xrs.mu.Lock()
+	if !xrs.closed && !xrs.reconnecting {
+		xrs.reconnect()
+	}
+	xrs.mu.Unlock()
+
+	return n, err
 }
 
 func (xrs *XrSession) Close() error {
-	return (*xrs.session).Close()
+	xrs.mu.Lock()
+	xrs.closed = true
+	xrs.cond.Broadcast()
+	session := xrs.session
+	client := xrs.client
+	xrs.mu.Unlock()
+
+	if session != nil {
+		session.Close()
+	}
+	if client != nil {
+		return client.Close()
+	}
+	return nil
 }
@@ -0,0 +1,160 @@
+// Streaming variant of Get for results too big to comfortably materialize
+// in one go, such as a wildcard path's worth of interface counters on a big
+// chassis.
+
+package xrm2m
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jsonrpc2"
+)
+
+// GetStream incrementally parses the response to a Get against path, so
+// memory use stays bounded no matter how big the result is. Get, in
+// contrast, fully materializes the whole response into [][]interface{}
+// before returning, which is fine for most paths but can mean buffering many
+// megabytes of JSON for a wildcard path against a big chassis.
+//
+// A GetStream runs over its own dedicated SSH session (a second
+// `run json_rpc_server` against the same host), rather than m2m's, so it
+// doesn't compete with m2m.Client's permanently-running background reader
+// for bytes off the same stream - that reader starts at NewClient time and
+// runs for the connection's whole lifetime, not just while another call is
+// outstanding, so sharing the stream here would race it. The dedicated
+// session also means a GetStream can safely be used concurrently with other
+// calls on the same M2MClient. Call Close when done with it, including on
+// an early exit before Next reaches the end.
+type GetStream struct {
+	session *XrSession
+	dec     *json.Decoder
+	err     error
+	done    bool
+}
+
+// GetStream starts a Get against path and returns an iterator over its
+// result rows. Respects m2m.MaxResponseBytes the same way ordinary calls do.
+func (m2m *M2MClient) GetStream(path string) (*GetStream, error) {
+	if err := m2m.checkError(); err != nil {
+		return nil, err
+	}
+
+	xrs, err := NewXrSession(m2m.host, m2m.creds, "run json_rpc_server")
+	if err != nil {
+		m2m.noteResult("get", err)
+		return nil, err
+	}
+
+	req := struct {
+		Jsonrpc string                 `json:"jsonrpc"`
+		Id      int64                  `json:"id"`
+		Method  string                 `json:"method"`
+		Params  map[string]interface{} `json:"params"`
+	}{"2.0", 1, "get", map[string]interface{}{"path": path}}
+
+	if err := json.NewEncoder(xrs).Encode(&req); err != nil {
+		xrs.Close()
+		m2m.noteResult("get", err)
+		return nil, err
+	}
+
+	gs := &GetStream{
+		session: xrs,
+		dec:     json.NewDecoder(jsonrpc2.LimitReader(xrs, &m2m.MaxResponseBytes)),
+	}
+	if err := gs.enterResult(); err != nil {
+		xrs.Close()
+		m2m.noteResult("get", err)
+		return nil, err
+	}
+	return gs, nil
+}
+
+// enterResult walks the top-level response object token by token up to the
+// start of its "result" array (or surfaces a JSON-RPC error if that's what
+// came back instead), leaving the decoder positioned to read result
+// elements one at a time via Next.
+func (gs *GetStream) enterResult() error {
+	if t, err := gs.dec.Token(); err != nil || t != json.Delim('{') {
+		return fmt.Errorf("xrm2m: malformed get response: expected '{': %v", err)
+	}
+
+	for gs.dec.More() {
+		keyTok, err := gs.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := keyTok.(string)
+
+		switch key {
+		case "result":
+			if t, err := gs.dec.Token(); err != nil || t != json.Delim('[') {
+				return fmt.Errorf("xrm2m: malformed get response: expected 'result' array: %v", err)
+			}
+			return nil
+
+		case "error":
+			var rpcErr struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			if err := gs.dec.Decode(&rpcErr); err != nil {
+				return err
+			}
+			return fmt.Errorf("%s (code %d)", rpcErr.Message, rpcErr.Code)
+
+		default:
+			var discard interface{}
+			if err := gs.dec.Decode(&discard); err != nil {
+				return err
+			}
+		}
+	}
+	return errors.New("xrm2m: malformed get response: no result or error field")
+}
+
+// Next decodes the next row of the result. It returns ok=false once the
+// result is exhausted or a decode error occurs; call Err afterwards to tell
+// the two apart. Once Next returns ok=false, the dedicated session backing
+// the stream has been closed and Next must not be called again.
+func (gs *GetStream) Next() (row []interface{}, ok bool) {
+	if gs.done || gs.err != nil {
+		return nil, false
+	}
+
+	if !gs.dec.More() {
+		// consume the closing ']'; More also reports false on a read error
+		// (such as MaxResponseBytes being exceeded), which Token surfaces
+		if _, err := gs.dec.Token(); err != nil {
+			gs.err = err
+		}
+		gs.done = true
+		gs.session.Close()
+		return nil, false
+	}
+
+	if err := gs.dec.Decode(&row); err != nil {
+		gs.err = err
+		gs.done = true
+		gs.session.Close()
+		return nil, false
+	}
+	return row, true
+}
+
+// Err returns the error, if any, that ended iteration early.
+func (gs *GetStream) Err() error {
+	return gs.err
+}
+
+// Close releases the stream's dedicated session. Safe to call after Next
+// has already returned ok=false (which closes it itself), or to abandon a
+// stream early before iterating it to completion.
+func (gs *GetStream) Close() error {
+	if gs.done {
+		return nil
+	}
+	gs.done = true
+	return gs.session.Close()
+}